@@ -0,0 +1,96 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Message is the websocket frame getMsgByte encodes. Every event (ping,
+// speed, lifecycle) the client receives shares this shape; only the
+// fields relevant to Info are populated, the rest marshal as their zero
+// value (omitted where tagged omitempty), except Lost, which is "0.00%"
+// on every frame that carries no PingStats.
+type Message struct {
+	Id   int    `json:"id"`
+	Info string `json:"info"`
+	// Ping and Lost are populated for "gotping": Ping is the average
+	// latency in ms, Lost the formatted loss percentage.
+	Ping int64  `json:"ping"`
+	Lost string `json:"lost"`
+	// PingMin/PingMax/PingMdev carry the rest of a "gotping" PingStats
+	// probe: min/max latency and mean deviation (jitter), in ms.
+	PingMin  int64 `json:"pingMin,omitempty"`
+	PingMax  int64 `json:"pingMax,omitempty"`
+	PingMdev int64 `json:"pingMdev,omitempty"`
+	// Avg/MaxSpeed/Speed are populated for "gotspeed": the running
+	// average, peak, and most recent instantaneous throughput in bytes/s.
+	Avg      int64 `json:"avg,omitempty"`
+	MaxSpeed int64 `json:"maxSpeed,omitempty"`
+	Speed    int64 `json:"speed,omitempty"`
+	// Concurrency is populated for "gotspeed" and "gotlatency" frames
+	// emitted by autotuneSpeed's ramp, so the UI can show the connection
+	// count each measurement was taken at.
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// getMsgByte encodes one websocket event frame. option's shape depends on
+// info:
+//   - "gotping": a single *PingStats
+//   - "gotlatency": a *PingStats, then an optional concurrency int
+//   - "gotspeed": avg, max, speed (int64 or int, so -1 literals work),
+//     then an optional concurrency int
+//
+// Any other info (e.g. "started", "startping", "startspeed", "endone",
+// "eof") carries no payload beyond id/info.
+func getMsgByte(index int, info string, option ...interface{}) []byte {
+	msg := Message{Id: index, Info: info, Lost: "0.00%"}
+	switch info {
+	case "gotping":
+		if len(option) > 0 {
+			applyPingStats(&msg, option[0])
+		}
+	case "gotlatency":
+		if len(option) > 0 {
+			applyPingStats(&msg, option[0])
+		}
+		if len(option) > 1 {
+			if c, ok := option[1].(int); ok {
+				msg.Concurrency = c
+			}
+		}
+	case "gotspeed":
+		for i, dst := range []*int64{&msg.Avg, &msg.MaxSpeed, &msg.Speed} {
+			if len(option) <= i {
+				break
+			}
+			switch v := option[i].(type) {
+			case int64:
+				*dst = v
+			case int:
+				*dst = int64(v)
+			}
+		}
+		if len(option) > 3 {
+			if c, ok := option[3].(int); ok {
+				msg.Concurrency = c
+			}
+		}
+	}
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+// applyPingStats copies a *PingStats probe result into msg's ping fields.
+// option is interface{} because every info kind shares getMsgByte's one
+// variadic signature.
+func applyPingStats(msg *Message, option interface{}) {
+	stats, ok := option.(*PingStats)
+	if !ok || stats == nil {
+		return
+	}
+	msg.Ping = stats.Avg
+	msg.PingMin = stats.Min
+	msg.PingMax = stats.Max
+	msg.PingMdev = stats.Mdev
+	msg.Lost = fmt.Sprintf("%.2f%%", stats.Loss)
+}
@@ -0,0 +1,54 @@
+package web
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetMsgByteGotPingCarriesFullStats(t *testing.T) {
+	stats := &PingStats{Min: 10, Avg: 20, Max: 30, Mdev: 5, Loss: 25, Count: 3}
+	var msg Message
+	if err := json.Unmarshal(getMsgByte(1, "gotping", stats), &msg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if msg.Ping != 20 || msg.PingMin != 10 || msg.PingMax != 30 || msg.PingMdev != 5 {
+		t.Fatalf("msg = %+v, want ping=20 pingMin=10 pingMax=30 pingMdev=5", msg)
+	}
+	if msg.Lost != "25.00%" {
+		t.Fatalf("Lost = %q, want 25.00%%", msg.Lost)
+	}
+}
+
+func TestGetMsgByteGotSpeed(t *testing.T) {
+	var msg Message
+	if err := json.Unmarshal(getMsgByte(1, "gotspeed", int64(100), int64(200), int64(150)), &msg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if msg.Avg != 100 || msg.MaxSpeed != 200 || msg.Speed != 150 {
+		t.Fatalf("msg = %+v, want avg=100 maxSpeed=200 speed=150", msg)
+	}
+	if msg.Concurrency != 0 {
+		t.Fatalf("Concurrency = %d, want 0 when no concurrency arg is passed", msg.Concurrency)
+	}
+}
+
+func TestGetMsgByteGotSpeedCarriesConcurrency(t *testing.T) {
+	var msg Message
+	if err := json.Unmarshal(getMsgByte(1, "gotspeed", int64(100), int64(200), int64(150), 4), &msg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if msg.Concurrency != 4 {
+		t.Fatalf("Concurrency = %d, want 4", msg.Concurrency)
+	}
+}
+
+func TestGetMsgByteGotLatency(t *testing.T) {
+	stats := &PingStats{Min: 5, Avg: 8, Max: 12, Mdev: 1, Loss: 0}
+	var msg Message
+	if err := json.Unmarshal(getMsgByte(1, "gotlatency", stats, 8), &msg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if msg.Ping != 8 || msg.PingMin != 5 || msg.PingMax != 12 || msg.Concurrency != 8 {
+		t.Fatalf("msg = %+v, want ping=8 pingMin=5 pingMax=12 concurrency=8", msg)
+	}
+}
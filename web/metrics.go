@@ -0,0 +1,206 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xxf098/lite-proxy/common"
+	"github.com/xxf098/lite-proxy/download"
+)
+
+// NodeResult is the last completed measurement for one node: the shape
+// both MetricsHandler's gauges and ResultsHandler's JSON snapshot are
+// built from.
+type NodeResult struct {
+	Group     string    `json:"group"`
+	Remark    string    `json:"remark"`
+	Protocol  string    `json:"protocol"`
+	Host      string    `json:"host"`
+	PingMs    int64     `json:"pingMs"`
+	SpeedBps  int64     `json:"speedBytes"`
+	LossRatio float64   `json:"lossRatio"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+var metricsStore = struct {
+	mu      sync.Mutex
+	results map[string]NodeResult
+}{results: make(map[string]NodeResult)}
+
+// recordResult upserts the metrics/exporter snapshot for one node, keyed
+// by group+remark+protocol+host so repeated runs overwrite rather than
+// accumulate.
+func recordResult(r NodeResult) {
+	r.UpdatedAt = time.Now()
+	metricsStore.mu.Lock()
+	defer metricsStore.mu.Unlock()
+	metricsStore.results[r.Group+"|"+r.Remark+"|"+r.Protocol+"|"+r.Host] = r
+}
+
+func snapshotResults() []NodeResult {
+	metricsStore.mu.Lock()
+	defer metricsStore.mu.Unlock()
+	out := make([]NodeResult, 0, len(metricsStore.results))
+	for _, r := range metricsStore.results {
+		out = append(out, r)
+	}
+	return out
+}
+
+// MetricsHandler serves Prometheus text-exposition gauges
+// litespeedtest_node_ping_ms, litespeedtest_node_speed_bytes and
+// litespeedtest_node_loss_ratio, each labeled by group/remark/protocol/host,
+// for every node recorded so far. Each row is that node's most recent
+// result, updated as the node finishes; rows are not grouped by batch, so
+// mid-batch they mix new and earlier results, and nodes of earlier
+// batches stay listed.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, res := range snapshotResults() {
+		labels := fmt.Sprintf(`{group=%q,remark=%q,protocol=%q,host=%q}`, res.Group, res.Remark, res.Protocol, res.Host)
+		fmt.Fprintf(w, "litespeedtest_node_ping_ms%s %d\n", labels, res.PingMs)
+		fmt.Fprintf(w, "litespeedtest_node_speed_bytes%s %d\n", labels, res.SpeedBps)
+		fmt.Fprintf(w, "litespeedtest_node_loss_ratio%s %f\n", labels, res.LossRatio)
+	}
+}
+
+// ResultsHandler serves the same per-node snapshot as MetricsHandler (the
+// most recent result of every node recorded so far, not one batch) as
+// structured JSON, for external dashboards and CI pipelines that don't
+// want to speak the websocket frame protocol.
+func ResultsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshotResults())
+}
+
+// linkProtocolHost extracts the scheme and the host:port used as metric
+// labels. vmess and ssr carry no host outside their base64 body, so those
+// two are decoded first; the rest (trojan/ss/vless/hysteria) already
+// expose host:port in the plain URI.
+func linkProtocolHost(link string) (protocol, host string) {
+	parts := strings.SplitN(link, "://", 2)
+	protocol = parts[0]
+	if len(parts) < 2 {
+		return protocol, ""
+	}
+	rest := parts[1]
+	switch strings.ToLower(protocol) {
+	case "vmess":
+		return protocol, vmessLinkHost(rest)
+	case "ssr":
+		return protocol, ssrLinkHost(rest)
+	}
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		rest = rest[at+1:]
+	}
+	rest = strings.SplitN(rest, "?", 2)[0]
+	rest = strings.SplitN(rest, "#", 2)[0]
+	return protocol, rest
+}
+
+// vmessLinkHost decodes a vmess:// body's base64 JSON and returns its
+// server address as host:port.
+func vmessLinkHost(body string) string {
+	data, err := common.DecodeB64(body)
+	if err != nil {
+		return ""
+	}
+	var v vmessShareLink
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return ""
+	}
+	return v.Add + ":" + v.Port
+}
+
+// ssrLinkHost decodes a ssr:// body's base64
+// server:port:protocol:method:obfs:password form and returns host:port.
+func ssrLinkHost(body string) string {
+	data, err := common.DecodeB64(body)
+	if err != nil {
+		return ""
+	}
+	fields := strings.SplitN(data, ":", 3)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[0] + ":" + fields[1]
+}
+
+// buildNodeResult assembles the metrics snapshot row for one completed
+// node, shared by the live websocket-driven path and exporter mode. stats
+// is nil in SpeedOnly mode, where no ping was ever run; PingMs/LossRatio
+// are left zeroed rather than skipping the row, so SpeedOnly runs still
+// show up in /metrics and /results.json.
+func buildNodeResult(group, link string, stats *PingStats, speed int64) NodeResult {
+	protocol, host := linkProtocolHost(link)
+	_, remarks, err := getRemarks(link)
+	if err != nil {
+		remarks = host
+	}
+	r := NodeResult{
+		Group:    group,
+		Remark:   remarks,
+		Protocol: protocol,
+		Host:     host,
+		SpeedBps: speed,
+	}
+	if stats != nil {
+		r.PingMs = stats.Avg
+		r.LossRatio = stats.Loss / 100
+	}
+	return r
+}
+
+// ExporterConfig configures exporter mode: periodically re-run a stored
+// subscription/options pair on a schedule and keep the /metrics and
+// /results.json snapshot fresh without a client driving the websocket.
+type ExporterConfig struct {
+	Options  *ProfileTestOptions
+	Links    []string
+	Interval time.Duration
+}
+
+// RunExporter runs batches against cfg.Links on cfg.Interval until ctx is
+// canceled. Wire it up behind a CLI flag / config option for "exporter
+// mode" alongside the normal websocket server.
+func RunExporter(ctx context.Context, cfg ExporterConfig) {
+	runExporterBatch(ctx, cfg)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runExporterBatch(ctx, cfg)
+		}
+	}
+}
+
+func runExporterBatch(ctx context.Context, cfg ExporterConfig) {
+	pinger := NewPinger(cfg.Options.PingMethod, defaultPingCount)
+	for _, link := range cfg.Links {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		stats, err := pinger.Ping(link)
+		if err != nil || stats.Avg < 1 {
+			continue
+		}
+		ch := make(chan int64, 1)
+		go func() {
+			for range ch {
+			}
+		}()
+		speed, _ := download.Download(link, cfg.Options.Timeout, cfg.Options.Timeout, ch)
+		close(ch)
+		recordResult(buildNodeResult(cfg.Options.GroupName, link, stats, speed))
+	}
+}
@@ -0,0 +1,56 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestLinkProtocolHostVmess(t *testing.T) {
+	body, _ := json.Marshal(vmessShareLink{Add: "example.com", Port: "443"})
+	link := "vmess://" + base64.StdEncoding.EncodeToString(body)
+	protocol, host := linkProtocolHost(link)
+	if protocol != "vmess" || host != "example.com:443" {
+		t.Fatalf("linkProtocolHost() = (%q, %q), want (vmess, example.com:443)", protocol, host)
+	}
+}
+
+func TestLinkProtocolHostSSR(t *testing.T) {
+	body := base64.StdEncoding.EncodeToString([]byte("example.com:8989:origin:aes-256-cfb:plain:cGFzcw"))
+	link := "ssr://" + body
+	protocol, host := linkProtocolHost(link)
+	if protocol != "ssr" || host != "example.com:8989" {
+		t.Fatalf("linkProtocolHost() = (%q, %q), want (ssr, example.com:8989)", protocol, host)
+	}
+}
+
+func TestLinkProtocolHostTrojan(t *testing.T) {
+	protocol, host := linkProtocolHost("trojan://secret@example.com:8443?sni=example.com#node")
+	if protocol != "trojan" || host != "example.com:8443" {
+		t.Fatalf("linkProtocolHost() = (%q, %q), want (trojan, example.com:8443)", protocol, host)
+	}
+}
+
+func TestLinkProtocolHostShadowsocks(t *testing.T) {
+	protocol, host := linkProtocolHost("ss://YWVzLTI1Ni1nY206cHc@example.com:8388#node")
+	if protocol != "ss" || host != "example.com:8388" {
+		t.Fatalf("linkProtocolHost() = (%q, %q), want (ss, example.com:8388)", protocol, host)
+	}
+}
+
+func TestBuildNodeResultWithStats(t *testing.T) {
+	stats := &PingStats{Avg: 42, Loss: 50}
+	r := buildNodeResult("Default Group", "trojan://pw@example.com:443#node", stats, 1000)
+	if r.PingMs != 42 || r.LossRatio != 0.5 || r.SpeedBps != 1000 {
+		t.Fatalf("r = %+v, want pingMs=42 lossRatio=0.5 speedBps=1000", r)
+	}
+}
+
+func TestBuildNodeResultNilStats(t *testing.T) {
+	// SpeedOnly mode never runs a ping, so stats is nil; the row should
+	// still be built with zeroed ping fields rather than panicking.
+	r := buildNodeResult("Default Group", "trojan://pw@example.com:443#node", nil, 1000)
+	if r.PingMs != 0 || r.LossRatio != 0 || r.SpeedBps != 1000 {
+		t.Fatalf("r = %+v, want pingMs=0 lossRatio=0 speedBps=1000", r)
+	}
+}
@@ -0,0 +1,51 @@
+package web
+
+import "testing"
+
+func TestAggregatePingSamples(t *testing.T) {
+	stats := aggregatePingSamples([]int64{10, 20, 30}, 4)
+	if stats.Min != 10 || stats.Max != 30 {
+		t.Fatalf("Min/Max = %d/%d, want 10/30", stats.Min, stats.Max)
+	}
+	if stats.Avg != 20 {
+		t.Fatalf("Avg = %d, want 20", stats.Avg)
+	}
+	if stats.Count != 3 {
+		t.Fatalf("Count = %d, want 3", stats.Count)
+	}
+	if stats.Loss != 25 {
+		t.Fatalf("Loss = %f, want 25 (1 of 4 attempts missing)", stats.Loss)
+	}
+}
+
+func TestAggregatePingSamplesAllLost(t *testing.T) {
+	stats := aggregatePingSamples(nil, 4)
+	if stats.Count != 0 {
+		t.Fatalf("Count = %d, want 0", stats.Count)
+	}
+	if stats.Loss != 100 {
+		t.Fatalf("Loss = %f, want 100", stats.Loss)
+	}
+}
+
+func TestNewPingerDispatch(t *testing.T) {
+	if _, ok := NewPinger("http", 4).(*httpPinger); !ok {
+		t.Fatal(`NewPinger("http", 4) did not return a *httpPinger`)
+	}
+	if _, ok := NewPinger("tcp", 4).(*tcpPinger); !ok {
+		t.Fatal(`NewPinger("tcp", 4) did not return a *tcpPinger`)
+	}
+	if _, ok := NewPinger("not-a-real-method", 4).(*tcpPinger); !ok {
+		t.Fatal("NewPinger() with an unrecognized method should fall back to *tcpPinger")
+	}
+}
+
+func TestNewPingerDefaultsCount(t *testing.T) {
+	p, ok := NewPinger("tcp", 0).(*tcpPinger)
+	if !ok {
+		t.Fatal(`NewPinger("tcp", 0) did not return a *tcpPinger`)
+	}
+	if p.count != defaultPingCount {
+		t.Fatalf("count = %d, want defaultPingCount (%d) for a non-positive count", p.count, defaultPingCount)
+	}
+}
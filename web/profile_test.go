@@ -0,0 +1,97 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/gorilla/websocket"
+)
+
+// newTestConn upgrades an httptest server to a websocket and returns the
+// client side of the connection; the server side drains whatever the
+// client side writes.
+func newTestConn(t *testing.T) (*websocket.Conn, func()) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial test server: %v", err)
+	}
+	return conn, func() {
+		conn.Close()
+		srv.Close()
+	}
+}
+
+func TestProfileTestStopDrainsGoroutines(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	conn, cleanup := newTestConn(t)
+	defer cleanup()
+
+	p := &ProfileTest{
+		Conn:        conn,
+		MessageType: websocket.TextMessage,
+		Options: &ProfileTestOptions{
+			GroupName:     "Default Group",
+			SpeedTestMode: PingOnly,
+			Concurrency:   2,
+			Timeout:       200 * time.Millisecond,
+		},
+		Links: []string{"vless://127.0.0.1:1", "vless://127.0.0.1:2"},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.testAll(context.Background())
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	p.Stop()
+	<-done
+}
+
+func TestAutotuneDecisionKeepsRampingWhileGrowing(t *testing.T) {
+	keepGoing, peak := autotuneDecision(100, 200, 2)
+	if !keepGoing {
+		t.Fatal("expected ramp to continue: throughput more than doubled")
+	}
+	if peak != 200 {
+		t.Fatalf("peak = %d, want 200", peak)
+	}
+}
+
+func TestAutotuneDecisionStopsOnPlateau(t *testing.T) {
+	keepGoing, peak := autotuneDecision(100, 102, 2)
+	if keepGoing {
+		t.Fatal("expected ramp to stop: growth under autotuneGrowthThreshold")
+	}
+	if peak != 102 {
+		t.Fatalf("peak = %d, want 102 (still the new max even when plateaued)", peak)
+	}
+}
+
+func TestAutotuneDecisionStopsAtMaxConcurrency(t *testing.T) {
+	keepGoing, _ := autotuneDecision(0, 1000, autotuneMaxConcurrency)
+	if keepGoing {
+		t.Fatal("expected ramp to stop once concurrency reaches autotuneMaxConcurrency")
+	}
+}
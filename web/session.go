@@ -0,0 +1,124 @@
+package web
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// sessionBufferSize bounds how many encoded events are retained per
+	// session so a client that never reconnects doesn't leak memory.
+	sessionBufferSize = 1000
+	// sessionTTL is how long an idle session buffer is kept around
+	// waiting for a reconnect before it's evicted.
+	sessionTTL = 5 * time.Minute
+	// sessionSweepInterval is how often the background sweeper checks for
+	// expired sessions, independent of getSessionBuffer traffic, so a
+	// session that finishes and is never resumed doesn't linger in
+	// sessionStore.store until some other session happens to be touched.
+	sessionSweepInterval = time.Minute
+)
+
+// bufferedEvent is one getMsgByte-encoded frame tagged with its position
+// in the session so a reconnecting client can ask to resume "from" it.
+type bufferedEvent struct {
+	index int
+	data  []byte
+}
+
+// sessionBuffer is a bounded, TTL'd ring of buffered events for a single
+// resumable test session.
+type sessionBuffer struct {
+	mu       sync.Mutex
+	events   []bufferedEvent
+	next     int
+	expireAt time.Time
+}
+
+func newSessionBuffer() *sessionBuffer {
+	return &sessionBuffer{expireAt: time.Now().Add(sessionTTL)}
+}
+
+func (b *sessionBuffer) append(data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, bufferedEvent{index: b.next, data: data})
+	b.next++
+	if len(b.events) > sessionBufferSize {
+		b.events = b.events[len(b.events)-sessionBufferSize:]
+	}
+	b.expireAt = time.Now().Add(sessionTTL)
+}
+
+// expired reports whether b has outlived its TTL as of now. b.expireAt is
+// written under b.mu by append, so it must be read under the same lock
+// rather than directly by a caller only holding sessionStore.mu.
+func (b *sessionBuffer) expired(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.After(b.expireAt)
+}
+
+// since returns the encoded events with index >= from, in order.
+func (b *sessionBuffer) since(from int) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([][]byte, 0, len(b.events))
+	for _, e := range b.events {
+		if e.index >= from {
+			out = append(out, e.data)
+		}
+	}
+	return out
+}
+
+var sessionStore = struct {
+	mu    sync.Mutex
+	store map[string]*sessionBuffer
+}{store: make(map[string]*sessionBuffer)}
+
+var startSessionSweeperOnce sync.Once
+
+// getSessionBuffer returns the buffer for id, creating it on first use,
+// and opportunistically evicts sessions that outlived their TTL. It also
+// starts the background sweeper on first call so expired sessions are
+// reclaimed even if no other session is ever touched again.
+func getSessionBuffer(id string) *sessionBuffer {
+	startSessionSweeperOnce.Do(startSessionSweeper)
+	sessionStore.mu.Lock()
+	defer sessionStore.mu.Unlock()
+	sweepExpiredSessionsLocked()
+	b, ok := sessionStore.store[id]
+	if !ok {
+		b = newSessionBuffer()
+		sessionStore.store[id] = b
+	}
+	return b
+}
+
+// sweepExpiredSessionsLocked deletes every session past its TTL. Callers
+// must hold sessionStore.mu.
+func sweepExpiredSessionsLocked() {
+	now := time.Now()
+	for k, v := range sessionStore.store {
+		if v.expired(now) {
+			delete(sessionStore.store, k)
+		}
+	}
+}
+
+// startSessionSweeper runs sweepExpiredSessionsLocked on a ticker for the
+// lifetime of the process, so a session that's never resumed and never
+// followed by other session traffic still gets evicted instead of sitting
+// in sessionStore.store indefinitely.
+func startSessionSweeper() {
+	go func() {
+		ticker := time.NewTicker(sessionSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sessionStore.mu.Lock()
+			sweepExpiredSessionsLocked()
+			sessionStore.mu.Unlock()
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionBufferSince(t *testing.T) {
+	b := newSessionBuffer()
+	for i := 0; i < 5; i++ {
+		b.append([]byte{byte(i)})
+	}
+	got := b.since(2)
+	if len(got) != 3 {
+		t.Fatalf("since(2) = %d events, want 3", len(got))
+	}
+	for i, data := range got {
+		want := byte(i + 2)
+		if data[0] != want {
+			t.Errorf("event %d = %d, want %d", i, data[0], want)
+		}
+	}
+}
+
+func TestSessionBufferBoundedSize(t *testing.T) {
+	b := newSessionBuffer()
+	for i := 0; i < sessionBufferSize+10; i++ {
+		b.append([]byte{byte(i)})
+	}
+	if len(b.events) != sessionBufferSize {
+		t.Fatalf("len(events) = %d, want %d", len(b.events), sessionBufferSize)
+	}
+	got := b.since(0)
+	if got[0][0] != byte(10) {
+		t.Fatalf("oldest retained event = %d, want %d", got[0][0], 10)
+	}
+}
+
+func TestGetSessionBufferEvictsExpired(t *testing.T) {
+	id := "test-session-ttl"
+	b := getSessionBuffer(id)
+	b.append([]byte("x"))
+	b.expireAt = time.Now().Add(-time.Second)
+
+	fresh := getSessionBuffer(id)
+	if fresh == b {
+		t.Fatal("expected an expired session buffer to be evicted and replaced")
+	}
+	if len(fresh.events) != 0 {
+		t.Fatalf("fresh buffer should start empty, got %d events", len(fresh.events))
+	}
+}
@@ -0,0 +1,307 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/xxf098/lite-proxy/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Subscription payload formats recognized by parseSubscriptionPayload.
+// SubscriptionAuto content-sniffs: base64+regex, then Clash YAML, then
+// sing-box JSON, then SIP008 JSON.
+const (
+	SubscriptionAuto    = ""
+	SubscriptionBase64  = "base64"
+	SubscriptionClash   = "clash"
+	SubscriptionSingBox = "sing-box"
+	SubscriptionSIP008  = "sip008"
+)
+
+// parseSubscriptionPayload turns a fetched subscription body into a link
+// list, either via the format named by SubscriptionFormat or, for
+// SubscriptionAuto, by trying each known format in turn.
+func parseSubscriptionPayload(data string, format string) ([]string, error) {
+	switch format {
+	case SubscriptionBase64:
+		msg, err := common.DecodeB64(data)
+		if err != nil {
+			return nil, err
+		}
+		return parseLinks(msg)
+	case SubscriptionClash:
+		return parseClashYAML(data)
+	case SubscriptionSingBox:
+		return parseSingBoxJSON(data)
+	case SubscriptionSIP008:
+		return parseSIP008JSON(data)
+	}
+	if msg, err := common.DecodeB64(data); err == nil {
+		if links, err := parseLinks(msg); err == nil {
+			return links, nil
+		}
+	}
+	if links, err := parseClashYAML(data); err == nil {
+		return links, nil
+	}
+	if links, err := parseSingBoxJSON(data); err == nil {
+		return links, nil
+	}
+	if links, err := parseSIP008JSON(data); err == nil {
+		return links, nil
+	}
+	return nil, ErrInvalidData
+}
+
+// clashConfig is the slice of a Clash/Clash.Meta config this tester cares
+// about: the proxies array. Each proxy is left as a generic map since its
+// shape varies by type (vmess/trojan/ss/vless/hysteria).
+type clashConfig struct {
+	Proxies []map[string]interface{} `yaml:"proxies"`
+}
+
+func parseClashYAML(data string) ([]string, error) {
+	var cfg clashConfig
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Proxies) == 0 {
+		return nil, errors.New("no proxies key")
+	}
+	links := make([]string, 0, len(cfg.Proxies))
+	for _, proxy := range cfg.Proxies {
+		link, err := clashProxyToLink(proxy)
+		if err != nil {
+			continue
+		}
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		return nil, ErrInvalidData
+	}
+	return links, nil
+}
+
+func clashProxyToLink(proxy map[string]interface{}) (string, error) {
+	switch strings.ToLower(mapString(proxy, "type")) {
+	case "vmess":
+		return clashVmessLink(proxy), nil
+	case "trojan":
+		return clashTrojanLink(proxy), nil
+	case "ss", "shadowsocks":
+		return clashShadowsocksLink(proxy), nil
+	case "vless":
+		return clashVlessLink(proxy), nil
+	case "hysteria", "hysteria2":
+		return clashHysteriaLink(proxy), nil
+	default:
+		return "", fmt.Errorf("unsupported clash proxy type %q", mapString(proxy, "type"))
+	}
+}
+
+// mapString reads key as a string, coercing numeric/bool YAML scalars.
+func mapString(m map[string]interface{}, key string) string {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func mapBool(m map[string]interface{}, key string) bool {
+	v, _ := m[key].(bool)
+	return v
+}
+
+// mapNested walks a dotted path of nested maps, as produced by yaml.v3 for
+// keys like ws-opts.headers.Host.
+func mapNested(m map[string]interface{}, path ...string) string {
+	var cur interface{} = m
+	for _, key := range path {
+		next, ok := cur.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		cur, ok = next[key]
+		if !ok {
+			return ""
+		}
+	}
+	s, _ := cur.(string)
+	return s
+}
+
+type vmessShareLink struct {
+	V    string `json:"v"`
+	Ps   string `json:"ps"`
+	Add  string `json:"add"`
+	Port string `json:"port"`
+	ID   string `json:"id"`
+	Aid  string `json:"aid"`
+	Net  string `json:"net"`
+	Type string `json:"type"`
+	Host string `json:"host"`
+	Path string `json:"path"`
+	TLS  string `json:"tls"`
+	SNI  string `json:"sni"`
+}
+
+func clashVmessLink(p map[string]interface{}) string {
+	v := vmessShareLink{
+		V:    "2",
+		Ps:   mapString(p, "name"),
+		Add:  mapString(p, "server"),
+		Port: mapString(p, "port"),
+		ID:   mapString(p, "uuid"),
+		Aid:  mapString(p, "alterId"),
+		Net:  mapString(p, "network"),
+		Type: "none",
+		Host: mapNested(p, "ws-opts", "headers", "Host"),
+		Path: mapNested(p, "ws-opts", "path"),
+		SNI:  mapString(p, "servername"),
+	}
+	if v.Net == "" {
+		v.Net = "tcp"
+	}
+	if mapBool(p, "tls") {
+		v.TLS = "tls"
+	}
+	body, _ := json.Marshal(v)
+	return "vmess://" + base64.StdEncoding.EncodeToString(body)
+}
+
+func clashTrojanLink(p map[string]interface{}) string {
+	query := trojanStyleQuery(p)
+	return fmt.Sprintf("trojan://%s@%s:%s?%s#%s",
+		url.QueryEscape(mapString(p, "password")), mapString(p, "server"), mapString(p, "port"),
+		query, url.QueryEscape(mapString(p, "name")))
+}
+
+func clashShadowsocksLink(p map[string]interface{}) string {
+	userinfo := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", mapString(p, "cipher"), mapString(p, "password"))))
+	return fmt.Sprintf("ss://%s@%s:%s#%s",
+		userinfo, mapString(p, "server"), mapString(p, "port"), url.QueryEscape(mapString(p, "name")))
+}
+
+func clashVlessLink(p map[string]interface{}) string {
+	query := trojanStyleQuery(p)
+	return fmt.Sprintf("vless://%s@%s:%s?%s#%s",
+		mapString(p, "uuid"), mapString(p, "server"), mapString(p, "port"),
+		query, url.QueryEscape(mapString(p, "name")))
+}
+
+func clashHysteriaLink(p map[string]interface{}) string {
+	query := fmt.Sprintf("auth=%s&peer=%s&insecure=%v",
+		url.QueryEscape(mapString(p, "auth_str")), url.QueryEscape(mapString(p, "sni")), mapBool(p, "skip-cert-verify"))
+	return fmt.Sprintf("hysteria://%s:%s?%s#%s",
+		mapString(p, "server"), mapString(p, "port"), query, url.QueryEscape(mapString(p, "name")))
+}
+
+// trojanStyleQuery builds the query string shared by the trojan and vless
+// URI forms: security (tls or none), sni and network type.
+// sni is percent-encoded: it comes straight from the Clash config and a
+// value like "a b" or "a&b" would otherwise corrupt the query string.
+func trojanStyleQuery(p map[string]interface{}) string {
+	sni := mapString(p, "sni")
+	if sni == "" {
+		sni = mapString(p, "servername")
+	}
+	network := mapString(p, "network")
+	if network == "" {
+		network = "tcp"
+	}
+	security := "tls"
+	if !mapBool(p, "tls") {
+		security = "none"
+	}
+	return fmt.Sprintf("security=%s&sni=%s&type=%s", security, url.QueryEscape(sni), network)
+}
+
+// singBoxConfig is the slice of a sing-box config.json this tester cares
+// about: the outbounds array.
+type singBoxConfig struct {
+	Outbounds []map[string]interface{} `json:"outbounds"`
+}
+
+func parseSingBoxJSON(data string) ([]string, error) {
+	var cfg singBoxConfig
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Outbounds) == 0 {
+		return nil, errors.New("no outbounds key")
+	}
+	links := make([]string, 0, len(cfg.Outbounds))
+	for _, out := range cfg.Outbounds {
+		link, err := singBoxOutboundToLink(out)
+		if err != nil {
+			continue
+		}
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		return nil, ErrInvalidData
+	}
+	return links, nil
+}
+
+func singBoxOutboundToLink(out map[string]interface{}) (string, error) {
+	name := mapString(out, "tag")
+	escapedName := url.QueryEscape(name)
+	switch strings.ToLower(mapString(out, "type")) {
+	case "vmess":
+		// name goes inside the JSON body, not the URI, so it's quoted with
+		// %q rather than percent-encoded; %q's Go quoting matches JSON for
+		// printable text, not for control characters.
+		return fmt.Sprintf("vmess://%s", base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(
+			`{"v":"2","ps":%q,"add":%q,"port":%q,"id":%q,"aid":"0","net":"tcp","type":"none"}`,
+			name, mapString(out, "server"), mapString(out, "server_port"), mapString(out, "uuid"))))), nil
+	case "trojan":
+		return fmt.Sprintf("trojan://%s@%s:%s?security=tls#%s",
+			url.QueryEscape(mapString(out, "password")), mapString(out, "server"), mapString(out, "server_port"), escapedName), nil
+	case "shadowsocks":
+		userinfo := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", mapString(out, "method"), mapString(out, "password"))))
+		return fmt.Sprintf("ss://%s@%s:%s#%s", userinfo, mapString(out, "server"), mapString(out, "server_port"), escapedName), nil
+	case "vless":
+		return fmt.Sprintf("vless://%s@%s:%s?security=tls#%s",
+			mapString(out, "uuid"), mapString(out, "server"), mapString(out, "server_port"), escapedName), nil
+	default:
+		return "", fmt.Errorf("unsupported sing-box outbound type %q", mapString(out, "type"))
+	}
+}
+
+// sip008Config is the SIP008 Shadowsocks subscription schema:
+// https://shadowsocks.org/guide/sip008.html
+type sip008Config struct {
+	Servers []struct {
+		Remarks  string `json:"remarks"`
+		Server   string `json:"server"`
+		Port     int    `json:"server_port"`
+		Password string `json:"password"`
+		Method   string `json:"method"`
+	} `json:"servers"`
+}
+
+func parseSIP008JSON(data string) ([]string, error) {
+	var cfg sip008Config
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Servers) == 0 {
+		return nil, errors.New("no servers key")
+	}
+	links := make([]string, 0, len(cfg.Servers))
+	for _, s := range cfg.Servers {
+		userinfo := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", s.Method, s.Password)))
+		links = append(links, fmt.Sprintf("ss://%s@%s:%d#%s", userinfo, s.Server, s.Port, url.QueryEscape(s.Remarks)))
+	}
+	return links, nil
+}
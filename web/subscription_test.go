@@ -0,0 +1,117 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestClashVmessLinkNumericYAMLCoercion(t *testing.T) {
+	// yaml.v3 decodes unquoted scalars like `port: 443` and `alterId: 0`
+	// as int/float, not string, so mapString must coerce them.
+	p := map[string]interface{}{
+		"name":    "node-1",
+		"server":  "example.com",
+		"port":    443,
+		"uuid":    "uuid-1",
+		"alterId": 0,
+		"tls":     true,
+	}
+	link := clashVmessLink(p)
+	const prefix = "vmess://"
+	if len(link) <= len(prefix) || link[:len(prefix)] != prefix {
+		t.Fatalf("clashVmessLink() = %q, want vmess:// prefix", link)
+	}
+	body, err := base64.StdEncoding.DecodeString(link[len(prefix):])
+	if err != nil {
+		t.Fatalf("body is not valid base64: %v", err)
+	}
+	var v vmessShareLink
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("body is not valid JSON: %v", err)
+	}
+	if v.Port != "443" || v.Aid != "0" || v.TLS != "tls" {
+		t.Fatalf("decoded vmess share link = %+v, want port=443 aid=0 tls=tls", v)
+	}
+}
+
+func TestClashTrojanLink(t *testing.T) {
+	p := map[string]interface{}{
+		"name":     "node-2",
+		"server":   "example.com",
+		"port":     8443,
+		"password": "secret",
+		"sni":      "example.com",
+		"tls":      true,
+	}
+	got := clashTrojanLink(p)
+	want := "trojan://secret@example.com:8443?security=tls&sni=example.com&type=tcp#node-2"
+	if got != want {
+		t.Fatalf("clashTrojanLink() = %q, want %q", got, want)
+	}
+}
+
+func TestClashTrojanLinkEscapesSpecialChars(t *testing.T) {
+	// password and name come straight from the Clash config; unescaped,
+	// "p@ss/word?" and "My Node #1" would corrupt the URI's authority,
+	// query and fragment delimiters.
+	p := map[string]interface{}{
+		"name":     "My Node #1 (HK)",
+		"server":   "example.com",
+		"port":     8443,
+		"password": "p@ss/word?",
+		"sni":      "a b",
+		"tls":      true,
+	}
+	got := clashTrojanLink(p)
+	want := "trojan://p%40ss%2Fword%3F@example.com:8443?security=tls&sni=a+b&type=tcp#My+Node+%231+%28HK%29"
+	if got != want {
+		t.Fatalf("clashTrojanLink() = %q, want %q", got, want)
+	}
+}
+
+func TestParseSingBoxJSONUnsupportedOutboundSkipped(t *testing.T) {
+	data := `{"outbounds":[
+		{"tag":"a","type":"vmess","server":"1.1.1.1","server_port":443,"uuid":"u"},
+		{"tag":"b","type":"direct"}
+	]}`
+	links, err := parseSingBoxJSON(data)
+	if err != nil {
+		t.Fatalf("parseSingBoxJSON() error = %v", err)
+	}
+	if len(links) != 1 {
+		t.Fatalf("got %d links, want 1 (unsupported outbound should be skipped)", len(links))
+	}
+}
+
+func TestParseSingBoxJSONEmptyOutbounds(t *testing.T) {
+	if _, err := parseSingBoxJSON(`{"outbounds":[]}`); err == nil {
+		t.Fatal("expected an error for an empty outbounds array")
+	}
+	if _, err := parseSingBoxJSON(`{"outbounds":[{"tag":"a","type":"direct"}]}`); err == nil {
+		t.Fatal("expected an error when every outbound is unsupported")
+	}
+}
+
+func TestParseSIP008JSON(t *testing.T) {
+	data := `{"servers":[
+		{"remarks":"node-3","server":"example.com","server_port":8388,"password":"pw","method":"aes-256-gcm"}
+	]}`
+	links, err := parseSIP008JSON(data)
+	if err != nil {
+		t.Fatalf("parseSIP008JSON() error = %v", err)
+	}
+	if len(links) != 1 {
+		t.Fatalf("got %d links, want 1", len(links))
+	}
+	const prefix = "ss://"
+	if len(links[0]) <= len(prefix) || links[0][:len(prefix)] != prefix {
+		t.Fatalf("parseSIP008JSON() link = %q, want ss:// prefix", links[0])
+	}
+}
+
+func TestParseSIP008JSONNoServers(t *testing.T) {
+	if _, err := parseSIP008JSON(`{"servers":[]}`); err == nil {
+		t.Fatal("expected an error for an empty servers array")
+	}
+}